@@ -0,0 +1,122 @@
+package sshtunnel
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// AuthPrivateKey loads a private key from path (optionally encrypted with
+// passphrase, pass "" for none) and returns it as an ssh.AuthMethod, so
+// callers don't need to import golang.org/x/crypto/ssh themselves.
+func AuthPrivateKey(path string, passphrase string) (ssh.AuthMethod, error) {
+	keyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("sshtunnel: read private key: %w", err)
+	}
+
+	var signer ssh.Signer
+	if passphrase == "" {
+		signer, err = ssh.ParsePrivateKey(keyBytes)
+	} else {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sshtunnel: parse private key: %w", err)
+	}
+
+	return ssh.PublicKeys(signer), nil
+}
+
+// AuthAgent returns an ssh.AuthMethod backed by the ssh-agent listening on
+// SSH_AUTH_SOCK. It fails if SSH_AUTH_SOCK is unset or unreachable.
+func AuthAgent() (ssh.AuthMethod, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("sshtunnel: SSH_AUTH_SOCK is not set")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("sshtunnel: dial ssh-agent: %w", err)
+	}
+
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), nil
+}
+
+// AuthKeyboardInteractive returns an ssh.AuthMethod that answers
+// keyboard-interactive challenges (e.g. OTP/2FA prompts) using answerFn,
+// which is called once per question with the question's text.
+func AuthKeyboardInteractive(answerFn func(question string) (string, error)) ssh.AuthMethod {
+	return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			answer, err := answerFn(question)
+			if err != nil {
+				return nil, err
+			}
+			answers[i] = answer
+		}
+		return answers, nil
+	})
+}
+
+// HostKeysFromKnownHosts returns an ssh.HostKeyCallback backed by the
+// known_hosts file at path, in place of the insecure
+// ssh.InsecureIgnoreHostKey() default.
+func HostKeysFromKnownHosts(path string) (ssh.HostKeyCallback, error) {
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("sshtunnel: read known_hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// HostKeysTOFU wraps HostKeysFromKnownHosts in trust-on-first-use mode: a
+// host key not yet present in the known_hosts file at path is appended and
+// accepted instead of rejected, matching `ssh`'s first-connection behavior.
+func HostKeysTOFU(path string) (ssh.HostKeyCallback, error) {
+	callback, err := HostKeysFromKnownHosts(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !isKnownHostsKeyError(err, &keyErr) || len(keyErr.Want) != 0 {
+			// Either a different error, or the host is known under a
+			// different, conflicting key: don't silently trust it.
+			return err
+		}
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("sshtunnel: open known_hosts for TOFU: %w", err)
+		}
+		defer f.Close()
+
+		line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+		if _, err := f.WriteString(line + "\n"); err != nil {
+			return fmt.Errorf("sshtunnel: write known_hosts for TOFU: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+func isKnownHostsKeyError(err error, target **knownhosts.KeyError) bool {
+	keyErr, ok := err.(*knownhosts.KeyError)
+	if !ok {
+		return false
+	}
+	*target = keyErr
+	return true
+}
@@ -0,0 +1,87 @@
+package sshtunnel
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BackoffStrategy decides how long to wait between reconnect/accept retries.
+type BackoffStrategy interface {
+	// NextDelay returns how long to wait before the next attempt.
+	NextDelay() time.Duration
+	// Reset is called after a successful accept, so the next
+	// failure starts backing off from the initial delay again.
+	Reset()
+}
+
+// fixedBackoff is the BackoffStrategy used when the user only configures
+// SetAttemptSleepTime, preserving the library's original fixed-delay behavior.
+type fixedBackoff struct {
+	delay time.Duration
+}
+
+func (b *fixedBackoff) NextDelay() time.Duration { return b.delay }
+func (b *fixedBackoff) Reset()                   {}
+
+// ExponentialBackoff is a BackoffStrategy that multiplies its delay by
+// Multiplier on every call, capped at Max, with +/- Jitter applied as a
+// fraction of the delay, so reconnect attempts against a bastion don't pile
+// up in lockstep. Reset() is called after a successful accept, restarting
+// the sequence from Initial.
+//
+// A single ExponentialBackoff is shared by every Forward on an SSHTunnel, so
+// NextDelay/Reset guard current with a mutex.
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+
+	mx      sync.Mutex
+	current time.Duration
+}
+
+// NewExponentialBackoff builds an ExponentialBackoff with the given
+// parameters. jitter is a fraction of the delay (e.g. 0.2 for +/-20%).
+func NewExponentialBackoff(initial time.Duration, max time.Duration, multiplier float64, jitter float64) *ExponentialBackoff {
+	return &ExponentialBackoff{
+		Initial:    initial,
+		Max:        max,
+		Multiplier: multiplier,
+		Jitter:     jitter,
+	}
+}
+
+func (b *ExponentialBackoff) NextDelay() time.Duration {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.current <= 0 {
+		b.current = b.Initial
+	}
+
+	delay := b.current
+
+	next := time.Duration(float64(b.current) * b.Multiplier)
+	if next > b.Max {
+		next = b.Max
+	}
+	b.current = next
+
+	if b.Jitter > 0 {
+		spread := float64(delay) * b.Jitter
+		delay += time.Duration(spread*2*rand.Float64() - spread)
+		if delay < 0 {
+			delay = 0
+		}
+	}
+
+	return delay
+}
+
+func (b *ExponentialBackoff) Reset() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.current = 0
+}
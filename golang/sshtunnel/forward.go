@@ -0,0 +1,357 @@
+package sshtunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ForwardKind identifies which direction a Forward copies data in.
+type ForwardKind int
+
+const (
+	ForwardKindForward ForwardKind = iota
+	ForwardKindReverse
+	ForwardKindDynamic
+)
+
+// Forward is a single local-forward/reverse-forward/dynamic-proxy rule
+// multiplexed over its SSHTunnel's shared ssh.Client. Forwards are created
+// with SSHTunnel.AddForward, AddReverse and AddDynamic (or the single-forward
+// ForwardTunnel/ReverseTunnel/DynamicTunnel convenience methods) and can be
+// closed individually without tearing down the underlying SSH connection.
+type Forward struct {
+	tunnel     *SSHTunnel
+	kind       ForwardKind
+	netNetwork string
+	netAddress string
+	sshNetwork string
+	sshAddress string
+	listener   net.Listener
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	mx         sync.Mutex
+}
+
+// AddForward adds a local forward: connections accepted on localAddr are
+// carried over the SSH session to remoteAddr, as seen from the SSH server.
+func (c *SSHTunnel) AddForward(localAddr string, remoteAddr string) *Forward {
+	return c.addForward(context.Background(), ForwardKindForward, localAddr, remoteAddr)
+}
+
+// AddReverse adds a reverse forward: connections accepted on remoteAddr, as
+// seen from the SSH server, are carried back and dialed against localAddr.
+func (c *SSHTunnel) AddReverse(remoteAddr string, localAddr string) *Forward {
+	return c.addForward(context.Background(), ForwardKindReverse, localAddr, remoteAddr)
+}
+
+// AddDynamic adds a dynamic SOCKS5 proxy forward, listening on localAddr.
+func (c *SSHTunnel) AddDynamic(localAddr string) *Forward {
+	return c.addForward(context.Background(), ForwardKindDynamic, localAddr, "")
+}
+
+// addForward creates and starts a Forward whose lifetime is bound to both
+// the tunnel's own lifetime (cancelled by SSHTunnel.Close) and ctx.
+func (c *SSHTunnel) addForward(ctx context.Context, kind ForwardKind, netAddr string, sshAddr string) *Forward {
+	forwardCtx, cancel := mergeContext(c.ctx, ctx)
+	f := &Forward{
+		tunnel:     c,
+		kind:       kind,
+		netNetwork: "tcp",
+		netAddress: netAddr,
+		sshNetwork: "tcp",
+		sshAddress: sshAddr,
+		ctx:        forwardCtx,
+		cancel:     cancel,
+	}
+
+	c.forwardsMx.Lock()
+	c.forwards = append(c.forwards, f)
+	c.forwardsMx.Unlock()
+
+	f.start()
+	return f
+}
+
+func (c *SSHTunnel) removeForward(f *Forward) {
+	c.forwardsMx.Lock()
+	defer c.forwardsMx.Unlock()
+	for i, existing := range c.forwards {
+		if existing == f {
+			c.forwards = append(c.forwards[:i], c.forwards[i+1:]...)
+			break
+		}
+	}
+}
+
+// Close stops this forward and releases its listener, leaving the shared
+// SSH session and any other forwards on the tunnel untouched.
+func (f *Forward) Close() {
+	f.cancel()
+	f.wg.Wait()
+	f.tunnel.removeForward(f)
+	f.tunnel.log("Forward Close successful")
+}
+
+func (f *Forward) setListener(listener net.Listener) {
+	f.mx.Lock()
+	f.listener = listener
+	f.mx.Unlock()
+}
+
+func (f *Forward) closeListener() {
+	f.mx.Lock()
+	listener := f.listener
+	f.listener = nil
+	f.mx.Unlock()
+
+	if listener != nil {
+		err := listener.Close()
+		if err != nil && err != io.EOF {
+			f.tunnel.log("Forward listener.Close failed: %v", err)
+		}
+	}
+}
+
+func (f *Forward) netListen() error {
+	c := f.tunnel
+	c.log("net.Listen on %s/%s...", f.netNetwork, f.netAddress)
+	var listenCfg net.ListenConfig
+	listener, err := listenCfg.Listen(f.ctx, f.netNetwork, f.netAddress)
+	if err != nil {
+		c.log("net.Listen failed: %v", err)
+		return err
+	}
+	c.log("net.Listen successful")
+	f.setListener(listener)
+	return nil
+}
+
+func (f *Forward) sshListen() error {
+	c := f.tunnel
+
+	c.mx.Lock()
+	client := c.sshClient
+	c.mx.Unlock()
+	if client == nil {
+		if err := c.sshConnectContext(f.ctx, client); err != nil {
+			return err
+		}
+		c.mx.Lock()
+		client = c.sshClient
+		c.mx.Unlock()
+	}
+
+	c.log("ssh.Listen on %s/%s...", f.sshNetwork, f.sshAddress)
+	listener, err := client.Listen(f.sshNetwork, f.sshAddress)
+	if err != nil {
+		if connErr := c.sshConnectContext(f.ctx, client); connErr != nil {
+			c.log("ssh.Listen failed: %v", err)
+			return err
+		}
+		c.mx.Lock()
+		client = c.sshClient
+		c.mx.Unlock()
+		listener, err = client.Listen(f.sshNetwork, f.sshAddress)
+		if err != nil {
+			c.log("ssh.Listen failed: %v", err)
+			return err
+		}
+	}
+	c.log("ssh.Listen successful")
+	f.setListener(listener)
+	return nil
+}
+
+func (f *Forward) accept() (net.Conn, error) {
+	f.mx.Lock()
+	listener := f.listener
+	f.mx.Unlock()
+
+	if listener == nil {
+		return nil, errors.New("listener is nil")
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		f.tunnel.log("accept failed: %v", err)
+		atomic.AddInt64(&f.tunnel.metricsState.acceptErrors, 1)
+		f.tunnel.emit(Event{Kind: EventAcceptError, Err: err})
+		return nil, err
+	}
+	f.tunnel.log("accept successful")
+	return conn, nil
+}
+
+// start launches the forward's accept loop on its own goroutine, tracked by
+// the parent tunnel's WaitGroup so Wait()/Close() also cover every forward.
+func (f *Forward) start() {
+	c := f.tunnel
+	c.log("Starting Forward")
+
+	c.wg.Add(1)
+	f.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer f.wg.Done()
+
+		// Unblock a pending Accept as soon as the forward's context ends.
+		go func() {
+			<-f.ctx.Done()
+			f.closeListener()
+		}()
+
+		c.log("Started Forward")
+
+		for f.ctx.Err() == nil {
+			var err error
+			if f.kind == ForwardKindReverse {
+				err = f.sshListen()
+			} else {
+				err = f.netListen()
+			}
+			if err != nil {
+				c.sleepBackoff(f.ctx)
+				continue
+			}
+
+			for f.ctx.Err() == nil {
+				conn, err := f.accept()
+				if err != nil {
+					f.closeListener()
+					c.sleepBackoff(f.ctx)
+					break
+				}
+				c.backoff.Reset()
+
+				c.wg.Add(1)
+				f.wg.Add(1)
+				go func(conn net.Conn) {
+					defer c.wg.Done()
+					defer f.wg.Done()
+					f.handle(conn)
+				}(conn)
+			}
+		}
+
+		c.log("Stopped Forward")
+	}()
+}
+
+// handle proxies a single accepted connection according to the forward's kind.
+func (f *Forward) handle(conn net.Conn) {
+	c := f.tunnel
+
+	var lConn, rConn net.Conn
+	var err error
+
+	switch f.kind {
+	case ForwardKindForward:
+		lConn = conn
+		rConn, err = c.sshDialToContext(f.ctx, f.sshNetwork, f.sshAddress)
+	case ForwardKindReverse:
+		rConn = conn
+		c.log("net.Dial to %s/%s...", f.netNetwork, f.netAddress)
+		lConn, err = dialNetContext(f.ctx, f.netNetwork, f.netAddress)
+		if err != nil {
+			c.log("net.Dial failed: %v", err)
+		}
+	case ForwardKindDynamic:
+		lConn = conn
+		var target string
+		target, err = c.socksHandshake(conn)
+		if err == nil {
+			rConn, err = c.sshDialToContext(f.ctx, "tcp", target)
+			if err != nil {
+				_ = socksWriteReply(conn, socks5ReplyGeneralFailure)
+			} else if werr := socksWriteReply(conn, socks5ReplySucceeded); werr != nil {
+				c.log("socks.WriteReply failed: %v", werr)
+			}
+		} else {
+			c.log("socks.Handshake failed: %v", err)
+		}
+	}
+
+	if err != nil {
+		atomic.AddInt64(&c.metricsState.dialFailures, 1)
+		closeErr := conn.Close()
+		if closeErr != nil && closeErr != io.EOF {
+			c.log("conn.Close failed: %v", closeErr)
+		}
+		return
+	}
+
+	lConn = newIdleTimeoutConn(lConn, c.idleTimeout, c.log)
+	rConn = newIdleTimeoutConn(rConn, c.idleTimeout, c.log)
+
+	if c.maxConnDuration > 0 {
+		timer := time.AfterFunc(c.maxConnDuration, func() {
+			_ = lConn.Close()
+			_ = rConn.Close()
+		})
+		defer timer.Stop()
+	}
+
+	started := time.Now()
+	atomic.AddInt64(&c.metricsState.activeConnections, 1)
+	c.emit(Event{Kind: EventConnectionOpened, RemoteAddr: conn.RemoteAddr().String()})
+
+	var bytesIn, bytesOut int64
+
+	// Close both sides as soon as either copy direction returns, so a
+	// half-close (the client or the backend closing its end first) tears
+	// down the whole connection instead of leaking the other direction's
+	// goroutine and socket blocked on Read forever.
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func(lConn net.Conn, rConn net.Conn) {
+		defer wg.Done()
+		// Pull remotePort to localPort
+		_, err := io.Copy(&countingWriter{lConn, &bytesOut}, rConn)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrDeadlineExceeded) {
+			c.log("io.Copy (1 / remote -> local) failed: %v", err)
+		}
+		_ = lConn.Close()
+		_ = rConn.Close()
+	}(lConn, rConn)
+
+	go func(lConn net.Conn, rConn net.Conn) {
+		defer wg.Done()
+		// Push localPort to remotePort
+		_, err := io.Copy(&countingWriter{rConn, &bytesIn}, lConn)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrDeadlineExceeded) {
+			c.log("io.Copy (2 / local -> remote) failed: %v", err)
+		}
+		_ = lConn.Close()
+		_ = rConn.Close()
+	}(lConn, rConn)
+
+	wg.Wait()
+
+	atomic.AddInt64(&c.metricsState.activeConnections, -1)
+	atomic.AddInt64(&c.metricsState.bytesIn, bytesIn)
+	atomic.AddInt64(&c.metricsState.bytesOut, bytesOut)
+	c.emit(Event{Kind: EventConnectionClosed, BytesIn: bytesIn, BytesOut: bytesOut, Duration: time.Since(started)})
+}
+
+// mergeContext returns a context that is done as soon as either a or b is
+// done, so a Forward can be stopped by either its own context or the
+// SSHTunnel's.
+func mergeContext(a context.Context, b context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-a.Done():
+		case <-b.Done():
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,187 @@
+package sshtunnel
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMultipleForwardsShareSSHClient exercises chunk0-2: several forwards
+// (AddForward and AddDynamic) added to the same SSHTunnel must multiplex
+// over one shared SSH connection rather than each dialing its own.
+func TestMultipleForwardsShareSSHClient(t *testing.T) {
+	server := newTestSSHServer(t)
+	defer server.close()
+
+	targetA := newEchoListener(t)
+	defer targetA.Close()
+	targetB := newEchoListener(t)
+	defer targetB.Close()
+
+	c := newTestTunnel(server)
+	defer c.Close()
+
+	forwardA := c.AddForward("127.0.0.1:0", targetA.Addr().String())
+	defer forwardA.Close()
+	forwardB := c.AddDynamic("127.0.0.1:0")
+	defer forwardB.Close()
+
+	// Give both forwards' accept loops a moment to start listening.
+	localAddrA := waitForListenerAddr(t, forwardA)
+	localAddrB := waitForListenerAddr(t, forwardB)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assertEchoThroughForward(t, localAddrA, "hello-a")
+	}()
+	go func() {
+		defer wg.Done()
+		assertSocksEcho(t, localAddrB, targetB.Addr().String(), "hello-b")
+	}()
+	wg.Wait()
+
+	c.mx.Lock()
+	client := c.sshClient
+	generation := c.generation
+	c.mx.Unlock()
+
+	if client == nil {
+		t.Fatal("sshClient is nil after proxying through two forwards")
+	}
+	if generation != 1 {
+		t.Errorf("generation = %d, want 1 (a single connect for both forwards)", generation)
+	}
+}
+
+// waitForListenerAddr polls until f has an active listener and returns its
+// address, so the caller doesn't race the forward's own accept-loop startup.
+func waitForListenerAddr(t *testing.T, f *Forward) string {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mx.Lock()
+		listener := f.listener
+		f.mx.Unlock()
+		if listener != nil {
+			return listener.Addr().String()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("forward never started listening")
+	return ""
+}
+
+func assertEchoThroughForward(t *testing.T, localAddr string, message string) {
+	t.Helper()
+	conn, err := dialWithRetry(localAddr)
+	if err != nil {
+		t.Errorf("dial forward: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(message)); err != nil {
+		t.Errorf("write: %v", err)
+		return
+	}
+	reply := make([]byte, len(message))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Errorf("read: %v", err)
+		return
+	}
+	if !bytes.Equal(reply, []byte(message)) {
+		t.Errorf("echo reply = %q, want %q", reply, message)
+	}
+}
+
+// assertSocksEcho drives a SOCKS5 CONNECT handshake against localAddr
+// (a DynamicTunnel listener), asking it to reach targetAddr, then checks
+// the echo round-trips.
+func assertSocksEcho(t *testing.T, localAddr string, targetAddr string, message string) {
+	t.Helper()
+
+	conn, err := dialWithRetry(localAddr)
+	if err != nil {
+		t.Errorf("dial SOCKS listener: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		t.Errorf("write greeting: %v", err)
+		return
+	}
+	selection := make([]byte, 2)
+	if _, err := io.ReadFull(conn, selection); err != nil {
+		t.Errorf("read method selection: %v", err)
+		return
+	}
+	if selection[1] != 0x00 {
+		t.Errorf("selected auth method = %d, want NO_AUTH", selection[1])
+		return
+	}
+
+	host, portStr, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		t.Errorf("split target addr: %v", err)
+		return
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Errorf("parse target port: %v", err)
+		return
+	}
+
+	request := []byte{0x05, 0x01, 0x00, 0x03, byte(len(host))}
+	request = append(request, host...)
+	request = append(request, byte(port>>8), byte(port))
+	if _, err := conn.Write(request); err != nil {
+		t.Errorf("write CONNECT request: %v", err)
+		return
+	}
+
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Errorf("read CONNECT reply: %v", err)
+		return
+	}
+	if reply[1] != 0x00 {
+		t.Errorf("CONNECT reply status = %d, want 0 (succeeded)", reply[1])
+		return
+	}
+
+	if _, err := conn.Write([]byte(message)); err != nil {
+		t.Errorf("write: %v", err)
+		return
+	}
+	echoed := make([]byte, len(message))
+	if _, err := io.ReadFull(conn, echoed); err != nil {
+		t.Errorf("read echo: %v", err)
+		return
+	}
+	if !bytes.Equal(echoed, []byte(message)) {
+		t.Errorf("echo reply = %q, want %q", echoed, message)
+	}
+}
+
+// dialWithRetry dials addr, retrying briefly since the forward's listener
+// may not have bound yet the instant this test reads its address.
+func dialWithRetry(addr string) (net.Conn, error) {
+	var lastErr error
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil, lastErr
+}
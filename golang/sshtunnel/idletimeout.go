@@ -0,0 +1,44 @@
+package sshtunnel
+
+import (
+	"net"
+	"time"
+)
+
+// idleTimeoutConn wraps a net.Conn, resetting its read/write deadline to
+// now+timeout on every successful Read/Write, so a long-lived but active
+// connection (SSH-in-SSH, a database session, a stream) isn't cut off after
+// a fixed lifetime the way a single SetDeadline call would.
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+// newIdleTimeoutConn arms conn's deadline and returns a wrapper that keeps
+// resetting it on activity. A timeout of zero disables the wrapping and
+// returns conn unchanged.
+func newIdleTimeoutConn(conn net.Conn, timeout time.Duration, logf func(format string, v ...any)) net.Conn {
+	if timeout <= 0 {
+		return conn
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		logf("SetDeadline failed: %v", err)
+	}
+	return &idleTimeoutConn{Conn: conn, timeout: timeout}
+}
+
+func (c *idleTimeoutConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err == nil {
+		_ = c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	return n, err
+}
+
+func (c *idleTimeoutConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if err == nil {
+		_ = c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	return n, err
+}
@@ -0,0 +1,80 @@
+package sshtunnel
+
+import (
+	"testing"
+	"time"
+)
+
+// TestIdleTimeoutClosesInactiveConnection exercises chunk0-7: a proxied
+// connection that sits idle past SetIdleTimeout must be torn down even
+// though neither side ever errors or hangs up on its own.
+func TestIdleTimeoutClosesInactiveConnection(t *testing.T) {
+	server := newTestSSHServer(t)
+	defer server.close()
+
+	target := newEchoListener(t)
+	defer target.Close()
+
+	c := newTestTunnel(server)
+	defer c.Close()
+	c.SetIdleTimeout(50 * time.Millisecond)
+
+	forward := c.AddForward("127.0.0.1:0", target.Addr().String())
+	defer forward.Close()
+	localAddr := waitForListenerAddr(t, forward)
+
+	conn, err := dialWithRetry(localAddr)
+	if err != nil {
+		t.Fatalf("dial forward: %v", err)
+	}
+	defer conn.Close()
+
+	// Never write anything, so the only thing that can end this connection
+	// is the idle timeout.
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1)
+	if _, err := conn.Read(buf); err == nil {
+		t.Fatal("Read() on an idle connection succeeded, want it closed by the idle timeout")
+	}
+}
+
+// TestMaxConnectionDurationClosesActiveConnection exercises chunk0-7: even
+// a connection with continuous activity (so the idle timeout never fires)
+// must be closed once SetMaxConnectionDuration elapses.
+func TestMaxConnectionDurationClosesActiveConnection(t *testing.T) {
+	server := newTestSSHServer(t)
+	defer server.close()
+
+	target := newEchoListener(t)
+	defer target.Close()
+
+	c := newTestTunnel(server)
+	defer c.Close()
+	c.SetIdleTimeout(0)
+	c.SetMaxConnectionDuration(100 * time.Millisecond)
+
+	forward := c.AddForward("127.0.0.1:0", target.Addr().String())
+	defer forward.Close()
+	localAddr := waitForListenerAddr(t, forward)
+
+	conn, err := dialWithRetry(localAddr)
+	if err != nil {
+		t.Fatalf("dial forward: %v", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(3 * time.Second))
+
+	deadline := time.Now().Add(3 * time.Second)
+	buf := make([]byte, 1)
+	for time.Now().Before(deadline) {
+		if _, err := conn.Write([]byte{'x'}); err != nil {
+			return // the connection was closed out from under us, as expected
+		}
+		if _, err := conn.Read(buf); err != nil {
+			return // likewise
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("connection with continuous activity was never closed by SetMaxConnectionDuration")
+}
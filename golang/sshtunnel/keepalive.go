@@ -0,0 +1,86 @@
+package sshtunnel
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SetKeepAlive enables periodic SSH keepalive probes sent on the shared
+// session every interval. After maxMisses consecutive failed probes, the
+// session is torn down and reconnected, so a dead control channel (common
+// behind NAT/firewalls) is detected and repaired proactively instead of
+// silently breaking every forward until one happens to fail a dial/accept.
+//
+// The keepalive goroutine is started by the first call with a positive
+// interval and maxMisses, and reads both values once when it starts; later
+// calls do not change the interval or maxMisses of a running keepalive.
+func (c *SSHTunnel) SetKeepAlive(interval time.Duration, maxMisses int) *SSHTunnel {
+	c.mx.Lock()
+	c.keepAliveInterval = interval
+	c.keepAliveMaxMisses = maxMisses
+	c.mx.Unlock()
+
+	if interval > 0 && maxMisses > 0 {
+		c.keepAliveOnce.Do(c.startKeepAlive)
+	}
+	return c
+}
+
+func (c *SSHTunnel) startKeepAlive() {
+	c.mx.Lock()
+	interval := c.keepAliveInterval
+	maxMisses := c.keepAliveMaxMisses
+	c.mx.Unlock()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		misses := 0
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-ticker.C:
+				if c.sendKeepAlive() {
+					misses = 0
+					continue
+				}
+
+				misses++
+				atomic.AddInt64(&c.metricsState.keepAliveMisses, 1)
+				c.log("keepalive miss %d/%d", misses, maxMisses)
+				if misses >= maxMisses {
+					c.log("keepalive: tearing down sshClient after %d misses", misses)
+					c.mx.Lock()
+					client := c.sshClient
+					c.mx.Unlock()
+					_ = c.sshConnect(client)
+					misses = 0
+				}
+			}
+		}
+	}()
+}
+
+// sendKeepAlive sends an OpenSSH-style keepalive request on the shared
+// session and reports whether it was answered.
+func (c *SSHTunnel) sendKeepAlive() bool {
+	c.mx.Lock()
+	client := c.sshClient
+	c.mx.Unlock()
+
+	if client == nil {
+		return false
+	}
+
+	_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+	if err != nil {
+		c.log("keepalive failed: %v", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package sshtunnel
+
+import (
+	"testing"
+	"time"
+)
+
+// TestKeepAliveDetectsFailureAndReconnects exercises chunk0-5: once the
+// shared session goes dead, the keepalive probe must start missing and,
+// after maxMisses, the tunnel reconnects on its own.
+func TestKeepAliveDetectsFailureAndReconnects(t *testing.T) {
+	server := newTestSSHServer(t)
+	defer server.close()
+
+	c := newTestTunnel(server)
+	defer c.Close()
+
+	if err := c.sshConnect(nil); err != nil {
+		t.Fatalf("sshConnect: %v", err)
+	}
+
+	c.SetKeepAlive(20*time.Millisecond, 1)
+
+	// Sever the connection from the server side without telling the
+	// tunnel, simulating a dead link (e.g. a NAT timeout).
+	server.dropConnections()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if c.Metrics().Reconnects > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	metrics := c.Metrics()
+	if metrics.KeepAliveMisses == 0 {
+		t.Error("KeepAliveMisses = 0, want at least one miss after the connection was dropped")
+	}
+	if metrics.Reconnects == 0 {
+		t.Error("Reconnects = 0, want the tunnel to have reconnected after missed keepalives")
+	}
+
+	c.mx.Lock()
+	client := c.sshClient
+	c.mx.Unlock()
+	if client == nil {
+		t.Error("sshClient is nil, want a freshly reconnected client")
+	}
+}
@@ -0,0 +1,176 @@
+package sshtunnel
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsState holds the tunnel's atomically-updated activity counters.
+type metricsState struct {
+	activeConnections int64
+	bytesIn           int64
+	bytesOut          int64
+	dialFailures      int64
+	reconnects        int64
+	acceptErrors      int64
+	keepAliveMisses   int64
+}
+
+// Metrics is a point-in-time snapshot of a tunnel's activity counters, as
+// returned by SSHTunnel.Metrics.
+type Metrics struct {
+	ActiveConnections int64
+	BytesIn           int64
+	BytesOut          int64
+	DialFailures      int64
+	Reconnects        int64
+	AcceptErrors      int64
+	KeepAliveMisses   int64
+}
+
+// Metrics returns a snapshot of the tunnel's current activity counters.
+func (c *SSHTunnel) Metrics() Metrics {
+	return Metrics{
+		ActiveConnections: atomic.LoadInt64(&c.metricsState.activeConnections),
+		BytesIn:           atomic.LoadInt64(&c.metricsState.bytesIn),
+		BytesOut:          atomic.LoadInt64(&c.metricsState.bytesOut),
+		DialFailures:      atomic.LoadInt64(&c.metricsState.dialFailures),
+		Reconnects:        atomic.LoadInt64(&c.metricsState.reconnects),
+		AcceptErrors:      atomic.LoadInt64(&c.metricsState.acceptErrors),
+		KeepAliveMisses:   atomic.LoadInt64(&c.metricsState.keepAliveMisses),
+	}
+}
+
+// EventKind identifies the kind of a structured Event delivered to OnEvent.
+type EventKind int
+
+const (
+	EventConnected EventKind = iota
+	EventConnectionOpened
+	EventConnectionClosed
+	EventReconnectAttempt
+	EventDialFailure
+	EventAcceptError
+)
+
+// Event is a structured notification about the tunnel's lifecycle, as
+// delivered to the callback registered with OnEvent. Which fields are set
+// depends on Kind: RemoteAddr on ConnectionOpened, BytesIn/BytesOut/Duration
+// on ConnectionClosed, Err on DialFailure/AcceptError.
+type Event struct {
+	Kind       EventKind
+	RemoteAddr string
+	BytesIn    int64
+	BytesOut   int64
+	Duration   time.Duration
+	Err        error
+}
+
+// OnEvent registers fn to be called for every structured lifecycle event.
+// Only one callback can be registered at a time; fn must return promptly,
+// since it runs on the tunnel's own goroutines. OnEvent is safe to call
+// while the tunnel is running.
+//
+// onEvent has its own mutex rather than sharing the tunnel's main c.mx,
+// since emit is called from within sshConnectContext while c.mx is held.
+func (c *SSHTunnel) OnEvent(fn func(Event)) *SSHTunnel {
+	c.onEventMx.Lock()
+	c.onEvent = fn
+	c.onEventMx.Unlock()
+	return c
+}
+
+func (c *SSHTunnel) emit(event Event) {
+	c.onEventMx.Lock()
+	onEvent := c.onEvent
+	c.onEventMx.Unlock()
+
+	if onEvent != nil {
+		onEvent(event)
+	}
+}
+
+// RegisterPrometheus publishes the tunnel's Metrics as gauges/counters on
+// reg. labels is an optional sequence of alternating label name/value pairs
+// applied as constant labels to every published metric, e.g.
+// RegisterPrometheus(reg, "tunnel", "db-bastion").
+func (c *SSHTunnel) RegisterPrometheus(reg prometheus.Registerer, labels ...string) error {
+	constLabels := prometheus.Labels{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		constLabels[labels[i]] = labels[i+1]
+	}
+
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   "sshtunnel",
+			Name:        "active_connections",
+			Help:        "Number of connections currently being proxied.",
+			ConstLabels: constLabels,
+		}, func() float64 { return float64(atomic.LoadInt64(&c.metricsState.activeConnections)) }),
+
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "sshtunnel",
+			Name:        "bytes_in_total",
+			Help:        "Total bytes copied from the local side into the tunnel.",
+			ConstLabels: constLabels,
+		}, func() float64 { return float64(atomic.LoadInt64(&c.metricsState.bytesIn)) }),
+
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "sshtunnel",
+			Name:        "bytes_out_total",
+			Help:        "Total bytes copied out of the tunnel to the local side.",
+			ConstLabels: constLabels,
+		}, func() float64 { return float64(atomic.LoadInt64(&c.metricsState.bytesOut)) }),
+
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "sshtunnel",
+			Name:        "dial_failures_total",
+			Help:        "Total failed dial attempts (SSH session or upstream target).",
+			ConstLabels: constLabels,
+		}, func() float64 { return float64(atomic.LoadInt64(&c.metricsState.dialFailures)) }),
+
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "sshtunnel",
+			Name:        "reconnects_total",
+			Help:        "Total successful SSH session reconnects.",
+			ConstLabels: constLabels,
+		}, func() float64 { return float64(atomic.LoadInt64(&c.metricsState.reconnects)) }),
+
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "sshtunnel",
+			Name:        "accept_errors_total",
+			Help:        "Total errors accepting connections on a forward's listener.",
+			ConstLabels: constLabels,
+		}, func() float64 { return float64(atomic.LoadInt64(&c.metricsState.acceptErrors)) }),
+
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "sshtunnel",
+			Name:        "keepalive_misses_total",
+			Help:        "Total missed/failed SSH keepalive probes.",
+			ConstLabels: constLabels,
+		}, func() float64 { return float64(atomic.LoadInt64(&c.metricsState.keepAliveMisses)) }),
+	}
+
+	for _, collector := range collectors {
+		if err := reg.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countingWriter wraps an io.Writer, atomically adding every successful
+// Write's byte count to n, so io.Copy calls can report accurate byte totals.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	atomic.AddInt64(cw.n, int64(n))
+	return n, err
+}
@@ -0,0 +1,84 @@
+package sshtunnel
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMetricsAndEventsOnForwardedConnection exercises chunk0-6: proxying a
+// connection through a forward must update the tunnel's Metrics counters
+// and fire the OnEvent callback with the matching lifecycle events.
+func TestMetricsAndEventsOnForwardedConnection(t *testing.T) {
+	server := newTestSSHServer(t)
+	defer server.close()
+
+	target := newEchoListener(t)
+	defer target.Close()
+
+	c := newTestTunnel(server)
+	defer c.Close()
+
+	var mx sync.Mutex
+	var kinds []EventKind
+	c.OnEvent(func(e Event) {
+		mx.Lock()
+		kinds = append(kinds, e.Kind)
+		mx.Unlock()
+	})
+
+	forward := c.AddForward("127.0.0.1:0", target.Addr().String())
+	defer forward.Close()
+	localAddr := waitForListenerAddr(t, forward)
+
+	conn, err := dialWithRetry(localAddr)
+	if err != nil {
+		t.Fatalf("dial forward: %v", err)
+	}
+
+	payload := []byte("metrics-and-events")
+	if _, err := conn.Write(payload); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	reply := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if c.Metrics().ActiveConnections == 0 && c.Metrics().BytesIn > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	metrics := c.Metrics()
+	if metrics.BytesIn == 0 {
+		t.Error("Metrics().BytesIn = 0, want > 0 after proxying data")
+	}
+	if metrics.BytesOut == 0 {
+		t.Error("Metrics().BytesOut = 0, want > 0 after proxying the echoed data")
+	}
+	if metrics.ActiveConnections != 0 {
+		t.Errorf("Metrics().ActiveConnections = %d, want 0 once the connection closed", metrics.ActiveConnections)
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	want := map[EventKind]bool{
+		EventConnected:        false,
+		EventConnectionOpened: false,
+		EventConnectionClosed: false,
+	}
+	for _, k := range kinds {
+		want[k] = true
+	}
+	for kind, seen := range want {
+		if !seen {
+			t.Errorf("OnEvent never saw event kind %v, events seen: %v", kind, kinds)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Permissions describes what a single authorized key is allowed to do,
+// mirroring OpenSSH's authorized_keys "permit-open"/"permit-listen" options:
+// which direct-tcpip targets the key may dial, and which tcpip-forward
+// binds it may request.
+type Permissions struct {
+	Comment      string
+	PermitOpen   []string
+	PermitListen []string
+}
+
+func (p *Permissions) allowsOpen(addr string) bool {
+	return containsAddr(p.PermitOpen, addr)
+}
+
+func (p *Permissions) allowsListen(addr string) bool {
+	return containsAddr(p.PermitListen, addr)
+}
+
+func containsAddr(patterns []string, addr string) bool {
+	for _, pattern := range patterns {
+		if pattern == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadAuthorizedKeys parses an authorized_keys file at path into a map from
+// marshaled public key bytes to the Permissions granted to that key, read
+// from its "permit-open"/"permit-listen" options, e.g.:
+//
+//	ssh-ed25519 AAAA... permit-open="127.0.0.1:5432" permit-listen="0.0.0.0:8080"
+func LoadAuthorizedKeys(path string) (map[string]*Permissions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("server: read authorized_keys: %w", err)
+	}
+
+	keys := map[string]*Permissions{}
+	for len(data) > 0 {
+		pubKey, comment, options, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("server: parse authorized_keys: %w", err)
+		}
+		data = rest
+
+		perms := &Permissions{Comment: comment}
+		for _, option := range options {
+			name, value, _ := strings.Cut(option, "=")
+			value = strings.Trim(value, `"`)
+			switch name {
+			case "permit-open":
+				perms.PermitOpen = append(perms.PermitOpen, value)
+			case "permit-listen":
+				perms.PermitListen = append(perms.PermitListen, value)
+			}
+		}
+
+		keys[string(pubKey.Marshal())] = perms
+	}
+
+	return keys, nil
+}
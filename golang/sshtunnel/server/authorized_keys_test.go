@@ -0,0 +1,36 @@
+package server
+
+import "testing"
+
+func TestPermissionsAllowsOpen(t *testing.T) {
+	perms := &Permissions{PermitOpen: []string{"127.0.0.1:5432"}}
+
+	if !perms.allowsOpen("127.0.0.1:5432") {
+		t.Error("allowsOpen(\"127.0.0.1:5432\") = false, want true")
+	}
+	if perms.allowsOpen("127.0.0.1:22") {
+		t.Error("allowsOpen(\"127.0.0.1:22\") = true, want false")
+	}
+}
+
+func TestPermissionsAllowsListen(t *testing.T) {
+	perms := &Permissions{PermitListen: []string{"0.0.0.0:8080"}}
+
+	if !perms.allowsListen("0.0.0.0:8080") {
+		t.Error("allowsListen(\"0.0.0.0:8080\") = false, want true")
+	}
+	if perms.allowsListen("0.0.0.0:9090") {
+		t.Error("allowsListen(\"0.0.0.0:9090\") = true, want false")
+	}
+}
+
+func TestPermissionsNoPermissionsDeniesEverything(t *testing.T) {
+	perms := &Permissions{}
+
+	if perms.allowsOpen("127.0.0.1:5432") {
+		t.Error("allowsOpen with no PermitOpen entries = true, want false")
+	}
+	if perms.allowsListen("0.0.0.0:8080") {
+		t.Error("allowsListen with no PermitListen entries = true, want false")
+	}
+}
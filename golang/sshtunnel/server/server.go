@@ -0,0 +1,381 @@
+// Package server is an embeddable, restricted "jump host" SSH server: it
+// authenticates inbound connections against an authorized_keys file and,
+// per key, only allows the direct-tcpip targets and tcpip-forward binds
+// that key's permit-open/permit-listen options name. Unlike running a full
+// OpenSSH server, there is no shell, SFTP, or exec support - only forwarding.
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// directTCPIPPayload is the RFC 4254 ssh-connection "direct-tcpip" channel
+// open payload.
+type directTCPIPPayload struct {
+	Host          string
+	Port          uint32
+	OriginAddress string
+	OriginPort    uint32
+}
+
+// forwardedTCPIPPayload is the RFC 4254 payload the server sends when
+// opening a "forwarded-tcpip" channel back to the client for an inbound
+// connection on a registered tcpip-forward listener.
+type forwardedTCPIPPayload struct {
+	Address       string
+	Port          uint32
+	OriginAddress string
+	OriginPort    uint32
+}
+
+// tcpipForwardPayload is the RFC 4254 "tcpip-forward"/"cancel-tcpip-forward"
+// global request payload.
+type tcpipForwardPayload struct {
+	Address string
+	Port    uint32
+}
+
+// Server is a minimal embeddable SSH server enforcing a per-key allow-list
+// of forwardable ports. Build one with NewServer and start accepting
+// connections with Serve.
+type Server struct {
+	config      *ssh.ServerConfig
+	keys        map[string]*Permissions
+	idleTimeout time.Duration
+	logger      func(format string, v ...any)
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	forwardsMx sync.Mutex
+	forwards   map[string]net.Listener
+}
+
+// NewServer builds a Server that authenticates incoming connections with
+// hostKey and against the keys in authorizedKeys (see LoadAuthorizedKeys).
+// idleTimeout is applied to every accepted direct-tcpip/forwarded-tcpip
+// channel; zero disables it.
+func NewServer(hostKey ssh.Signer, authorizedKeys map[string]*Permissions, idleTimeout time.Duration) *Server {
+	s := &Server{
+		keys:        authorizedKeys,
+		idleTimeout: idleTimeout,
+		logger:      log.Printf,
+		forwards:    map[string]net.Listener{},
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: s.publicKeyCallback,
+	}
+	config.AddHostKey(hostKey)
+	s.config = config
+
+	return s
+}
+
+// SetLogger overrides the server's logger, which defaults to log.Printf.
+func (s *Server) SetLogger(logger func(format string, v ...any)) *Server {
+	s.logger = logger
+	return s
+}
+
+func (s *Server) log(format string, v ...any) {
+	s.logger(format, v...)
+}
+
+func (s *Server) publicKeyCallback(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	fingerprint := string(key.Marshal())
+	if _, ok := s.keys[fingerprint]; !ok {
+		return nil, fmt.Errorf("server: unrecognized public key for %s", conn.User())
+	}
+	return &ssh.Permissions{
+		Extensions: map[string]string{"pubkey-fp": fingerprint},
+	}, nil
+}
+
+func (s *Server) permissionsFor(perms *ssh.Permissions) *Permissions {
+	if perms == nil {
+		return nil
+	}
+	return s.keys[perms.Extensions["pubkey-fp"]]
+}
+
+// Serve starts accepting SSH connections on network/address and returns
+// once the listener is up; connections are handled on background
+// goroutines until Close is called.
+func (s *Server) Serve(network string, address string) error {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return fmt.Errorf("server: listen: %w", err)
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				s.log("server: accept failed: %v", err)
+				return
+			}
+
+			s.wg.Add(1)
+			go func(conn net.Conn) {
+				defer s.wg.Done()
+				s.handleConn(conn)
+			}(conn)
+		}
+	}()
+
+	return nil
+}
+
+// Close stops accepting new connections, tears down any registered
+// tcpip-forward listeners, and waits for in-flight connections to finish.
+func (s *Server) Close() error {
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+
+	s.forwardsMx.Lock()
+	for key, listener := range s.forwards {
+		_ = listener.Close()
+		delete(s.forwards, key)
+	}
+	s.forwardsMx.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		s.log("server: handshake failed: %v", err)
+		_ = conn.Close()
+		return
+	}
+	defer sshConn.Close()
+
+	perms := s.permissionsFor(sshConn.Permissions)
+
+	go s.handleGlobalRequests(sshConn, reqs, perms)
+
+	for newChannel := range chans {
+		s.wg.Add(1)
+		go func(newChannel ssh.NewChannel) {
+			defer s.wg.Done()
+			s.handleChannel(sshConn, newChannel, perms)
+		}(newChannel)
+	}
+}
+
+func (s *Server) handleChannel(sshConn *ssh.ServerConn, newChannel ssh.NewChannel, perms *Permissions) {
+	if newChannel.ChannelType() != "direct-tcpip" {
+		_ = newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+		return
+	}
+
+	var payload directTCPIPPayload
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, "malformed direct-tcpip request")
+		return
+	}
+
+	target := net.JoinHostPort(payload.Host, fmt.Sprintf("%d", payload.Port))
+	if perms == nil || !perms.allowsOpen(target) {
+		s.log("server: rejecting direct-tcpip to %s for %s: not permitted", target, sshConn.User())
+		_ = newChannel.Reject(ssh.Prohibited, "target not permitted")
+		return
+	}
+
+	targetConn, err := net.Dial("tcp", target)
+	if err != nil {
+		s.log("server: dial %s failed: %v", target, err)
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		s.log("server: accept channel failed: %v", err)
+		_ = targetConn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	s.pipe(channel, targetConn)
+}
+
+func (s *Server) handleGlobalRequests(sshConn *ssh.ServerConn, reqs <-chan *ssh.Request, perms *Permissions) {
+	for req := range reqs {
+		switch req.Type {
+		case "tcpip-forward":
+			s.handleTCPIPForward(sshConn, req, perms)
+		case "cancel-tcpip-forward":
+			s.handleCancelTCPIPForward(sshConn, req)
+		default:
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func (s *Server) handleTCPIPForward(sshConn *ssh.ServerConn, req *ssh.Request, perms *Permissions) {
+	var payload tcpipForwardPayload
+	if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+		if req.WantReply {
+			_ = req.Reply(false, nil)
+		}
+		return
+	}
+
+	bindAddr := net.JoinHostPort(payload.Address, fmt.Sprintf("%d", payload.Port))
+	if perms == nil || !perms.allowsListen(bindAddr) {
+		s.log("server: rejecting tcpip-forward on %s for %s: not permitted", bindAddr, sshConn.User())
+		if req.WantReply {
+			_ = req.Reply(false, nil)
+		}
+		return
+	}
+
+	listener, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		s.log("server: listen %s failed: %v", bindAddr, err)
+		if req.WantReply {
+			_ = req.Reply(false, nil)
+		}
+		return
+	}
+
+	s.forwardsMx.Lock()
+	s.forwards[bindAddr] = listener
+	s.forwardsMx.Unlock()
+
+	if req.WantReply {
+		boundPort := listener.Addr().(*net.TCPAddr).Port
+		_ = req.Reply(true, ssh.Marshal(struct{ Port uint32 }{uint32(boundPort)}))
+	}
+
+	go s.acceptForwarded(sshConn, listener, payload.Address, bindAddr)
+}
+
+func (s *Server) acceptForwarded(sshConn *ssh.ServerConn, listener net.Listener, bindHost string, bindAddr string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		originHost, originPortStr, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		var originPort uint64
+		fmt.Sscanf(originPortStr, "%d", &originPort)
+
+		payload := ssh.Marshal(forwardedTCPIPPayload{
+			Address:       bindHost,
+			Port:          uint32(listener.Addr().(*net.TCPAddr).Port),
+			OriginAddress: originHost,
+			OriginPort:    uint32(originPort),
+		})
+
+		channel, requests, err := sshConn.OpenChannel("forwarded-tcpip", payload)
+		if err != nil {
+			s.log("server: open forwarded-tcpip for %s failed: %v", bindAddr, err)
+			_ = conn.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+
+		go s.pipe(channel, conn)
+	}
+}
+
+func (s *Server) handleCancelTCPIPForward(sshConn *ssh.ServerConn, req *ssh.Request) {
+	var payload tcpipForwardPayload
+	if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+		if req.WantReply {
+			_ = req.Reply(false, nil)
+		}
+		return
+	}
+
+	bindAddr := net.JoinHostPort(payload.Address, fmt.Sprintf("%d", payload.Port))
+
+	s.forwardsMx.Lock()
+	listener, ok := s.forwards[bindAddr]
+	delete(s.forwards, bindAddr)
+	s.forwardsMx.Unlock()
+
+	if ok {
+		_ = listener.Close()
+	}
+
+	if req.WantReply {
+		_ = req.Reply(ok, nil)
+	}
+}
+
+// pipe bidirectionally copies between an SSH channel and a plain net.Conn,
+// applying the server's idle timeout to the net.Conn side. Both sides are
+// closed as soon as either direction returns, so a half-close (either end
+// closing first) tears down the whole connection instead of leaving the
+// other direction's goroutine blocked on Read forever.
+func (s *Server) pipe(channel ssh.Channel, conn net.Conn) {
+	conn = newIdleTimeoutConn(conn, s.idleTimeout)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(conn, channel)
+		_ = channel.Close()
+		_ = conn.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(channel, conn)
+		_ = channel.Close()
+		_ = conn.Close()
+	}()
+	wg.Wait()
+}
+
+// newIdleTimeoutConn wraps conn so its deadline is reset on every
+// successful Read/Write. A timeout of zero disables the wrapping.
+func newIdleTimeoutConn(conn net.Conn, timeout time.Duration) net.Conn {
+	if timeout <= 0 {
+		return conn
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	return &idleTimeoutConn{Conn: conn, timeout: timeout}
+}
+
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleTimeoutConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err == nil {
+		_ = c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	return n, err
+}
+
+func (c *idleTimeoutConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if err == nil {
+		_ = c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	return n, err
+}
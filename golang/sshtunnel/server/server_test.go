@@ -0,0 +1,199 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestSigner generates a throwaway ed25519 ssh.Signer for use as a host
+// or client key in tests.
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromSigner(priv)
+	if err != nil {
+		t.Fatalf("ssh.NewSignerFromSigner: %v", err)
+	}
+	return signer
+}
+
+// startTestServer brings up a Server authenticating clientSigner with perms,
+// returning a connected *ssh.Client and a cleanup func.
+func startTestServer(t *testing.T, perms *Permissions) (*ssh.Client, func()) {
+	t.Helper()
+
+	hostSigner := newTestSigner(t)
+	clientSigner := newTestSigner(t)
+
+	keys := map[string]*Permissions{
+		string(clientSigner.PublicKey().Marshal()): perms,
+	}
+
+	s := NewServer(hostSigner, keys, 0)
+	s.SetLogger(func(string, ...any) {})
+	if err := s.Serve("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial server: %v", err)
+	}
+
+	clientConfig := &ssh.ClientConfig{
+		User:            "test",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(clientSigner)},
+		HostKeyCallback: ssh.FixedHostKey(hostSigner.PublicKey()),
+		Timeout:         3 * time.Second,
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, conn.RemoteAddr().String(), clientConfig)
+	if err != nil {
+		t.Fatalf("NewClientConn: %v", err)
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	cleanup := func() {
+		_ = sshClient.Close()
+		_ = s.Close()
+	}
+	return sshClient, cleanup
+}
+
+// newEchoListener starts a TCP listener that echoes back everything it
+// reads, for use as a direct-tcpip target in tests.
+func newEchoListener(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 4096)
+				for {
+					n, err := conn.Read(buf)
+					if n > 0 {
+						if _, werr := conn.Write(buf[:n]); werr != nil {
+							return
+						}
+					}
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestServerEnforcesPermitOpenEndToEnd(t *testing.T) {
+	allowed := newEchoListener(t)
+	defer allowed.Close()
+	denied := newEchoListener(t)
+	defer denied.Close()
+
+	sshClient, cleanup := startTestServer(t, &Permissions{
+		PermitOpen: []string{allowed.Addr().String()},
+	})
+	defer cleanup()
+
+	channel, err := sshClient.Dial("tcp", allowed.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial(allowed) = %v, want success", err)
+	}
+	defer channel.Close()
+
+	if _, err := channel.Write([]byte("ping")); err != nil {
+		t.Fatalf("write to allowed target: %v", err)
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(channel, reply); err != nil {
+		t.Fatalf("read from allowed target: %v", err)
+	}
+	if string(reply) != "ping" {
+		t.Errorf("echo reply = %q, want %q", reply, "ping")
+	}
+
+	if _, err := sshClient.Dial("tcp", denied.Addr().String()); err == nil {
+		t.Fatal("Dial(denied) succeeded, want rejection")
+	}
+}
+
+func TestServerServesConcurrentDirectTCPIPChannels(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer target.Close()
+
+	var acceptedMx sync.Mutex
+	var accepted []net.Conn
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			// Hold the connection open without reading/writing, so the
+			// server's pipe() for this channel blocks until the test
+			// closes it. If channels are serviced one at a time, a second
+			// concurrent Dial will hang behind this one.
+			acceptedMx.Lock()
+			accepted = append(accepted, conn)
+			acceptedMx.Unlock()
+		}
+	}()
+
+	sshClient, cleanup := startTestServer(t, &Permissions{
+		PermitOpen: []string{target.Addr().String()},
+	})
+	defer cleanup()
+
+	first, err := sshClient.Dial("tcp", target.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial(first) = %v, want success", err)
+	}
+	defer first.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		second, err := sshClient.Dial("tcp", target.Addr().String())
+		if err == nil {
+			second.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Dial(second) = %v, want success", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("second concurrent Dial blocked behind the first channel's pipe()")
+	}
+
+	acceptedMx.Lock()
+	for _, conn := range accepted {
+		_ = conn.Close()
+	}
+	acceptedMx.Unlock()
+}
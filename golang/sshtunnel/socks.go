@@ -0,0 +1,179 @@
+package sshtunnel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// SOCKS5 protocol constants, see RFC 1928 / RFC 1929.
+const (
+	socks5Version = 0x05
+
+	socks5AuthNoAuth         = 0x00
+	socks5AuthUsernamePass   = 0x02
+	socks5AuthNoAcceptable   = 0xFF
+	socks5UsernamePassOK     = 0x00
+	socks5UsernamePassFailed = 0x01
+
+	socks5CmdConnect = 0x01
+
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+
+	socks5ReplySucceeded           = 0x00
+	socks5ReplyGeneralFailure      = 0x01
+	socks5ReplyCommandNotSupported = 0x07
+)
+
+// socksHandshake performs the SOCKS5 negotiation on conn and returns the
+// "host:port" target the client asked to connect to.
+func (c *SSHTunnel) socksHandshake(conn net.Conn) (string, error) {
+	method, err := c.socksNegotiateAuth(conn)
+	if err != nil {
+		return "", err
+	}
+
+	if method == socks5AuthUsernamePass {
+		if err := c.socksAuthUsernamePassword(conn); err != nil {
+			return "", err
+		}
+	}
+
+	return socksReadRequest(conn)
+}
+
+// socksNegotiateAuth reads the client's greeting and picks an auth method.
+func (c *SSHTunnel) socksNegotiateAuth(conn net.Conn) (byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, fmt.Errorf("socks: read greeting: %w", err)
+	}
+	if header[0] != socks5Version {
+		return 0, fmt.Errorf("socks: unsupported version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return 0, fmt.Errorf("socks: read methods: %w", err)
+	}
+
+	requireAuth := c.socksUsername != "" || c.socksPassword != ""
+	chosen := byte(socks5AuthNoAcceptable)
+	for _, m := range methods {
+		if requireAuth && m == socks5AuthUsernamePass {
+			chosen = socks5AuthUsernamePass
+			break
+		}
+		if !requireAuth && m == socks5AuthNoAuth {
+			chosen = socks5AuthNoAuth
+			break
+		}
+	}
+
+	if _, err := conn.Write([]byte{socks5Version, chosen}); err != nil {
+		return 0, fmt.Errorf("socks: write method selection: %w", err)
+	}
+	if chosen == socks5AuthNoAcceptable {
+		return 0, errors.New("socks: no acceptable auth method")
+	}
+	return chosen, nil
+}
+
+// socksAuthUsernamePassword implements the RFC 1929 username/password subnegotiation.
+func (c *SSHTunnel) socksAuthUsernamePassword(conn net.Conn) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("socks: read auth header: %w", err)
+	}
+
+	username := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, username); err != nil {
+		return fmt.Errorf("socks: read username: %w", err)
+	}
+
+	plen := make([]byte, 1)
+	if _, err := io.ReadFull(conn, plen); err != nil {
+		return fmt.Errorf("socks: read password length: %w", err)
+	}
+
+	password := make([]byte, plen[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return fmt.Errorf("socks: read password: %w", err)
+	}
+
+	ok := string(username) == c.socksUsername && string(password) == c.socksPassword
+	status := byte(socks5UsernamePassOK)
+	if !ok {
+		status = socks5UsernamePassFailed
+	}
+	if _, err := conn.Write([]byte{0x01, status}); err != nil {
+		return fmt.Errorf("socks: write auth reply: %w", err)
+	}
+	if !ok {
+		return errors.New("socks: username/password rejected")
+	}
+	return nil
+}
+
+// socksReadRequest reads the CONNECT request and returns the "host:port" target.
+func socksReadRequest(conn net.Conn) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", fmt.Errorf("socks: read request: %w", err)
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("socks: unsupported version %d", header[0])
+	}
+	if header[1] != socks5CmdConnect {
+		_ = socksWriteReply(conn, socks5ReplyCommandNotSupported)
+		return "", fmt.Errorf("socks: unsupported command %d", header[1])
+	}
+
+	var host string
+	switch header[3] {
+	case socks5AddrIPv4:
+		addr := make([]byte, 4)
+		if _, err := io.ReadFull(conn, addr); err != nil {
+			return "", fmt.Errorf("socks: read ipv4 address: %w", err)
+		}
+		host = net.IP(addr).String()
+	case socks5AddrIPv6:
+		addr := make([]byte, 16)
+		if _, err := io.ReadFull(conn, addr); err != nil {
+			return "", fmt.Errorf("socks: read ipv6 address: %w", err)
+		}
+		host = net.IP(addr).String()
+	case socks5AddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", fmt.Errorf("socks: read domain length: %w", err)
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", fmt.Errorf("socks: read domain: %w", err)
+		}
+		host = string(domain)
+	default:
+		_ = socksWriteReply(conn, socks5ReplyGeneralFailure)
+		return "", fmt.Errorf("socks: unsupported address type %d", header[3])
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBytes); err != nil {
+		return "", fmt.Errorf("socks: read port: %w", err)
+	}
+	port := int(portBytes[0])<<8 | int(portBytes[1])
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// socksWriteReply sends a SOCKS5 reply with a zeroed bind address, which is
+// sufficient for CONNECT clients that ignore the bound address/port.
+func socksWriteReply(conn net.Conn, reply byte) error {
+	_, err := conn.Write([]byte{socks5Version, reply, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,180 @@
+package sshtunnel
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSocksReadRequestIPv4(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		_, _ = client.Write([]byte{socks5Version, socks5CmdConnect, 0x00, socks5AddrIPv4, 127, 0, 0, 1, 0x1F, 0x90})
+	}()
+
+	target, err := socksReadRequest(server)
+	if err != nil {
+		t.Fatalf("socksReadRequest: %v", err)
+	}
+	if want := "127.0.0.1:8080"; target != want {
+		t.Errorf("socksReadRequest() = %q, want %q", target, want)
+	}
+}
+
+func TestSocksReadRequestDomain(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	domain := "example.com"
+	go func() {
+		req := []byte{socks5Version, socks5CmdConnect, 0x00, socks5AddrDomain, byte(len(domain))}
+		req = append(req, domain...)
+		req = append(req, 0x00, 0x50)
+		_, _ = client.Write(req)
+	}()
+
+	target, err := socksReadRequest(server)
+	if err != nil {
+		t.Fatalf("socksReadRequest: %v", err)
+	}
+	if want := "example.com:80"; target != want {
+		t.Errorf("socksReadRequest() = %q, want %q", target, want)
+	}
+}
+
+func TestSocksReadRequestUnsupportedCommand(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		// socksReadRequest only reads the 4-byte header before rejecting an
+		// unsupported command, then writes a reply back that we must drain.
+		_, _ = client.Write([]byte{socks5Version, 0x02, 0x00, socks5AddrIPv4})
+		reply := make([]byte, 10)
+		_, _ = client.Read(reply)
+	}()
+
+	if _, err := socksReadRequest(server); err == nil {
+		t.Fatal("socksReadRequest() with unsupported command succeeded, want error")
+	}
+}
+
+func TestSocksNegotiateAuthNoAuth(t *testing.T) {
+	c := &SSHTunnel{}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	reply := make([]byte, 2)
+	var readErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = client.Write([]byte{socks5Version, 0x01, socks5AuthNoAuth})
+		_, readErr = client.Read(reply)
+	}()
+
+	method, err := c.socksNegotiateAuth(server)
+	if err != nil {
+		t.Fatalf("socksNegotiateAuth: %v", err)
+	}
+	if method != socks5AuthNoAuth {
+		t.Errorf("socksNegotiateAuth() = %d, want %d", method, socks5AuthNoAuth)
+	}
+
+	<-done
+	if readErr != nil {
+		t.Fatalf("read method selection: %v", readErr)
+	}
+	if reply[1] != socks5AuthNoAuth {
+		t.Errorf("method selection reply = %d, want %d", reply[1], socks5AuthNoAuth)
+	}
+}
+
+func TestSocksNegotiateAuthRequiresUsernamePassword(t *testing.T) {
+	c := &SSHTunnel{socksUsername: "user", socksPassword: "pass"}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = client.Write([]byte{socks5Version, 0x02, socks5AuthNoAuth, socks5AuthUsernamePass})
+		reply := make([]byte, 2)
+		_, _ = client.Read(reply)
+	}()
+
+	method, err := c.socksNegotiateAuth(server)
+	if err != nil {
+		t.Fatalf("socksNegotiateAuth: %v", err)
+	}
+	if method != socks5AuthUsernamePass {
+		t.Errorf("socksNegotiateAuth() = %d, want %d", method, socks5AuthUsernamePass)
+	}
+	<-done
+}
+
+func TestSocksAuthUsernamePassword(t *testing.T) {
+	c := &SSHTunnel{socksUsername: "user", socksPassword: "pass"}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	reply := make([]byte, 2)
+	var readErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := []byte{0x01, byte(len("user"))}
+		req = append(req, "user"...)
+		req = append(req, byte(len("pass")))
+		req = append(req, "pass"...)
+		_, _ = client.Write(req)
+		_, readErr = client.Read(reply)
+	}()
+
+	if err := c.socksAuthUsernamePassword(server); err != nil {
+		t.Fatalf("socksAuthUsernamePassword: %v", err)
+	}
+
+	<-done
+	if readErr != nil {
+		t.Fatalf("read auth reply: %v", readErr)
+	}
+	if reply[1] != socks5UsernamePassOK {
+		t.Errorf("auth reply status = %d, want %d", reply[1], socks5UsernamePassOK)
+	}
+}
+
+func TestSocksAuthUsernamePasswordRejectsWrongCredentials(t *testing.T) {
+	c := &SSHTunnel{socksUsername: "user", socksPassword: "pass"}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := []byte{0x01, byte(len("user"))}
+		req = append(req, "user"...)
+		req = append(req, byte(len("wrong")))
+		req = append(req, "wrong"...)
+		_, _ = client.Write(req)
+		reply := make([]byte, 2)
+		_, _ = client.Read(reply)
+	}()
+
+	if err := c.socksAuthUsernamePassword(server); err == nil {
+		t.Fatal("socksAuthUsernamePassword() with wrong password succeeded, want error")
+	}
+	<-done
+}
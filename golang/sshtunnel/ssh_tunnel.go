@@ -1,62 +1,118 @@
 package sshtunnel
 
 import (
-	"errors"
+	"context"
 	"golang.org/x/crypto/ssh"
 	"io"
 	"log"
 	"net"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type SSHTunnel struct {
-	sshConfig        *ssh.ClientConfig
-	host             string
-	sshClient        *ssh.Client
-	netNetwork       string
-	netAddress       string
-	sshNetwork       string
-	sshAddress       string
-	listener         net.Listener
-	closed           bool
-	attemptSleepTime time.Duration
-	ioTimeout        time.Duration
-	logger           func(format string, v ...any)
-	wg               *sync.WaitGroup
-	mx               *sync.Mutex
+	sshConfig          *ssh.ClientConfig
+	host               string
+	sshClient          *ssh.Client
+	netNetwork         string
+	netAddress         string
+	sshNetwork         string
+	sshAddress         string
+	idleTimeout        time.Duration
+	maxConnDuration    time.Duration
+	socksUsername      string
+	socksPassword      string
+	backoff            BackoffStrategy
+	keepAliveInterval  time.Duration
+	keepAliveMaxMisses int
+	keepAliveOnce      sync.Once
+	metricsState       metricsState
+	onEvent            func(Event)
+	onEventMx          sync.Mutex
+	logger             func(format string, v ...any)
+	wg                 *sync.WaitGroup
+	mx                 *sync.Mutex
+	connectMx          sync.Mutex
+	generation         uint64
+	forwards           []*Forward
+	forwardsMx         sync.Mutex
+	ctx                context.Context
+	cancel             context.CancelFunc
 }
 
 func NewSSHTunnel(sshConfig *ssh.ClientConfig, host string, localPort string, remotePort string) *SSHTunnel {
+	ctx, cancel := context.WithCancel(context.Background())
 	c := &SSHTunnel{
-		sshConfig:        sshConfig,
-		host:             host,
-		sshClient:        nil,
-		netNetwork:       "tcp",
-		netAddress:       "localhost:" + localPort,
-		sshNetwork:       "tcp",
-		sshAddress:       "localhost:" + remotePort,
-		listener:         nil,
-		closed:           false,
-		attemptSleepTime: 3 * time.Second,
-		ioTimeout:        30 * time.Second,
-		logger:           log.Printf,
-		wg:               &sync.WaitGroup{},
-		mx:               &sync.Mutex{},
+		sshConfig:   sshConfig,
+		host:        host,
+		netNetwork:  "tcp",
+		netAddress:  "localhost:" + localPort,
+		sshNetwork:  "tcp",
+		sshAddress:  "localhost:" + remotePort,
+		idleTimeout: 30 * time.Second,
+		backoff:     &fixedBackoff{delay: 3 * time.Second},
+		logger:      log.Printf,
+		wg:          &sync.WaitGroup{},
+		mx:          &sync.Mutex{},
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 	return c
 }
 
+// Close cancels the tunnel's lifetime context, which preempts any
+// in-progress reconnect/retry delay, closes every forward and the shared
+// SSH connection, then waits for everything to unwind.
 func (c *SSHTunnel) Close() {
-	c.closed = true
-	c.closeInternal()
+	c.cancel()
+
+	c.forwardsMx.Lock()
+	forwards := append([]*Forward(nil), c.forwards...)
+	c.forwardsMx.Unlock()
+	for _, f := range forwards {
+		f.Close()
+	}
+
+	c.closeSSH()
 	c.wg.Wait()
 	c.log("Close successful")
 }
 
 func (c *SSHTunnel) SetAttemptSleepTime(sleepTime time.Duration) *SSHTunnel {
-	c.attemptSleepTime = sleepTime
+	c.backoff = &fixedBackoff{delay: sleepTime}
+	return c
+}
+
+// SetBackoff overrides the delay strategy used between reconnect/retry
+// attempts, e.g. with an ExponentialBackoff, in place of the library's
+// default fixed delay.
+func (c *SSHTunnel) SetBackoff(backoff BackoffStrategy) *SSHTunnel {
+	c.backoff = backoff
+	return c
+}
+
+// SetIdleTimeout sets how long a proxied connection may go without a
+// successful Read/Write before it is closed. Zero disables the idle
+// timeout.
+func (c *SSHTunnel) SetIdleTimeout(timeout time.Duration) *SSHTunnel {
+	c.idleTimeout = timeout
+	return c
+}
+
+// SetMaxConnectionDuration caps how long a single proxied connection may
+// stay open regardless of activity, in addition to the idle timeout. Zero
+// (the default) disables the cap.
+func (c *SSHTunnel) SetMaxConnectionDuration(d time.Duration) *SSHTunnel {
+	c.maxConnDuration = d
+	return c
+}
+
+// SetSocksAuth requires SOCKS5 clients connecting through DynamicTunnel to
+// authenticate with username/password (RFC 1929) instead of NO_AUTH.
+func (c *SSHTunnel) SetSocksAuth(username string, password string) *SSHTunnel {
+	c.socksUsername = username
+	c.socksPassword = password
 	return c
 }
 
@@ -73,11 +129,9 @@ func (c *SSHTunnel) log(format string, v ...any) {
 	c.logger(format, v...)
 }
 
-func (c *SSHTunnel) closeInternal() {
-	c.closeListener()
-	c.closeSSH()
-}
 func (c *SSHTunnel) closeSSH() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
 	if c.sshClient != nil {
 		err := c.sshClient.Close()
 		if err != nil && err != io.EOF {
@@ -88,277 +142,167 @@ func (c *SSHTunnel) closeSSH() {
 	c.log("Closed sshClient")
 }
 
-func (c *SSHTunnel) closeListener() {
-	if c.listener != nil {
-		err := c.listener.Close()
-		if err != nil && err != io.EOF {
-			c.log("listener.Close failed: %v", err)
-		}
-		c.listener = nil
-	}
-	c.log("Closed listener")
+// sshConnect (re)dials the shared SSH session using the tunnel's own
+// lifetime context, so it is preempted by Close() but not by any single
+// forward's context. staleClient is the client the caller observed broken
+// (or nil, if it never had one); see sshConnectContext.
+func (c *SSHTunnel) sshConnect(staleClient *ssh.Client) error {
+	return c.sshConnectContext(c.ctx, staleClient)
 }
 
-func (c *SSHTunnel) sshConnect() error {
-	defer c.mx.Unlock()
+// sshConnectContext is like sshConnect, but the dial is also cancelled if
+// ctx is done, letting callers tie a reconnect attempt to a narrower
+// lifetime (e.g. a single forward).
+//
+// Forwards and the keepalive goroutine can all notice a dead session and
+// call this concurrently. connectMx single-flights the actual dial so only
+// one reconnect is ever in progress. staleClient must be the *ssh.Client
+// the caller itself observed to be missing/broken (nil if it never had
+// one); once connectMx is acquired, sshConnectContext only redials if
+// sshClient still equals staleClient, which means nobody has fixed it since
+// the caller looked. Re-reading sshClient at that point instead (rather
+// than trusting the caller's own observation) wouldn't work: a caller can
+// be scheduled after a concurrent reconnect already completed, and a fresh
+// read would just show that new, already-good client as unchanged, causing
+// a redundant redial.
+func (c *SSHTunnel) sshConnectContext(ctx context.Context, staleClient *ssh.Client) error {
+	c.connectMx.Lock()
+	defer c.connectMx.Unlock()
+
 	c.mx.Lock()
+	if c.sshClient != staleClient {
+		// Another caller already reconnected since we observed staleClient.
+		c.mx.Unlock()
+		return nil
+	}
+	wasConnected := staleClient != nil
+	c.mx.Unlock()
+
 	c.closeSSH()
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
 	c.log("ssh.Connect...")
-	client, err := ssh.Dial("tcp", c.host, c.sshConfig)
+	if wasConnected {
+		c.emit(Event{Kind: EventReconnectAttempt})
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.host)
 	if err != nil {
 		c.log("ssh.Connect failed: %v", err)
+		atomic.AddInt64(&c.metricsState.dialFailures, 1)
+		c.emit(Event{Kind: EventDialFailure, Err: err})
 		return err
-	} else {
-		c.log("ssh.Connect successful")
-		c.sshClient = client
-		return nil
 	}
-}
 
-func (c *SSHTunnel) netDial() (net.Conn, error) {
-	c.log("net.Dial to %s/%s...", c.netNetwork, c.netAddress)
-	conn, err := net.Dial(c.netNetwork, c.netAddress)
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.host, c.sshConfig)
 	if err != nil {
-		c.log("net.Dial failed: %v", err)
-		return nil, err
+		_ = conn.Close()
+		c.log("ssh.Connect failed: %v", err)
+		atomic.AddInt64(&c.metricsState.dialFailures, 1)
+		c.emit(Event{Kind: EventDialFailure, Err: err})
+		return err
 	}
-	c.log("net.Dial successful")
-	return conn, nil
-}
 
-func (c *SSHTunnel) sshDial() (net.Conn, error) {
-	c.log("ssh.Dial to %s/%s...", c.sshNetwork, c.sshAddress)
-	if c.sshClient != nil {
-		conn, err := c.sshClient.Dial(c.sshNetwork, c.sshAddress)
-		if err != nil {
-			_ = c.sshConnect()
-			conn, err = c.sshClient.Dial(c.sshNetwork, c.sshAddress)
-			if err != nil {
-				c.log("ssh.Dial failed: %v", err)
-				return nil, err
-			}
-		}
-		c.log("ssh.Dial successful")
-		return conn, nil
+	c.sshClient = ssh.NewClient(sshConn, chans, reqs)
+	c.generation++
+	c.log("ssh.Connect successful")
+	if wasConnected {
+		atomic.AddInt64(&c.metricsState.reconnects, 1)
 	}
-	c.log("ssh.Dial failed: sshClient is nil")
-	return nil, errors.New("sshClient is nil")
+	c.emit(Event{Kind: EventConnected})
+	return nil
 }
 
-func (c *SSHTunnel) netListen() error {
-	c.log("net.Listen on %s/%s...", c.netNetwork, c.netAddress)
-	listener, err := net.Listen(c.netNetwork, c.netAddress)
-	if err != nil {
-		c.log("net.Listen failed: %v", err)
-		return err
+// sshDialToContext opens a channel to address over the shared SSH session,
+// reconnecting once and retrying if the first dial fails.
+func (c *SSHTunnel) sshDialToContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	c.log("ssh.Dial to %s/%s...", network, address)
+
+	c.mx.Lock()
+	client := c.sshClient
+	c.mx.Unlock()
+
+	if client == nil {
+		if err := c.sshConnectContext(ctx, client); err != nil {
+			return nil, err
+		}
+		c.mx.Lock()
+		client = c.sshClient
+		c.mx.Unlock()
 	}
-	c.log("net.Listen successful")
-	c.listener = listener
-	return nil
-}
 
-func (c *SSHTunnel) sshListen() error {
-	c.log("ssh.Listen on %s/%s...", c.sshNetwork, c.sshAddress)
-	if c.sshClient != nil {
-		listener, err := c.sshClient.Listen(c.sshNetwork, c.sshAddress)
+	conn, err := client.Dial(network, address)
+	if err != nil {
+		if connErr := c.sshConnectContext(ctx, client); connErr != nil {
+			c.log("ssh.Dial failed: %v", err)
+			return nil, err
+		}
+		c.mx.Lock()
+		client = c.sshClient
+		c.mx.Unlock()
+		conn, err = client.Dial(network, address)
 		if err != nil {
-			_ = c.sshConnect()
-			listener, err = c.sshClient.Listen(c.sshNetwork, c.sshAddress)
-			if err != nil {
-				c.log("ssh.Listen failed: %v", err)
-				return err
-			}
+			c.log("ssh.Dial failed: %v", err)
+			return nil, err
 		}
-		c.log("ssh.Listen successful")
-		c.listener = listener
-		return nil
 	}
-	c.log("ssh.Listen failed: sshClient is nil")
-	return errors.New("sshClient is nil")
+	c.log("ssh.Dial successful")
+	return conn, nil
 }
 
-func (c *SSHTunnel) accept() (net.Conn, error) {
-	if c.listener != nil {
-		conn, err := c.listener.Accept()
-		if err == nil {
-			c.log("accept successful")
-			return conn, nil
-		} else {
-			c.log("accept failed: %v", err)
-			return nil, err
-		}
+// dialNetContext dials a local address independently of any tunnel's fixed
+// fields, as used by reverse forwards, with ctx cancelling the attempt.
+func dialNetContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+// sleepBackoff waits for the backoff strategy's next delay, returning early
+// if ctx is done, so Close() can preempt an in-progress retry delay.
+func (c *SSHTunnel) sleepBackoff(ctx context.Context) {
+	select {
+	case <-time.After(c.backoff.NextDelay()):
+	case <-ctx.Done():
 	}
-	return nil, errors.New("listener is nil")
 }
 
-func (c *SSHTunnel) ForwardTunnel() {
-	c.log("Starting Tunnel")
-
-	c.wg.Add(1)
-	go func() {
-		defer c.wg.Done()
-
-		c.log("Started Tunnel")
-
-		_ = c.sshConnect()
-
-		for !c.closed {
-			err := c.netListen()
-			if err != nil {
-				time.Sleep(c.attemptSleepTime)
-				continue
-			}
-
-			for !c.closed {
-				lConn, err := c.accept()
-				if err != nil {
-					c.closeListener()
-					time.Sleep(c.attemptSleepTime)
-					break
-				}
-
-				c.wg.Add(1)
-				go func(lConn net.Conn) {
-					defer c.wg.Done()
-
-					rConn, err := c.sshDial()
-
-					if err != nil {
-						err = lConn.Close()
-						if err != nil && err != io.EOF {
-							c.log("lConn.Close failed: %v", err)
-						}
-						time.Sleep(c.attemptSleepTime)
-						return
-					}
-
-					// set deadline for local connection
-					err = lConn.SetDeadline(time.Now().Add(c.ioTimeout))
-					if err != nil {
-						c.log("SetDeadline failed: %v", err)
-					}
-
-					wg := &sync.WaitGroup{}
-					wg.Add(2)
-					go func(lConn net.Conn, rConn net.Conn) {
-						defer wg.Done()
-						// Push localPort to remotePort
-						_, err := io.Copy(lConn, rConn)
-						if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrDeadlineExceeded) {
-							c.log("io.Copy (1 / local -> remote) failed: %v", err)
-						}
-					}(lConn, rConn)
-
-					go func(lConn net.Conn, rConn net.Conn) {
-						defer wg.Done()
-						// Pull remotePort to localPort
-						_, err := io.Copy(rConn, lConn)
-						if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrDeadlineExceeded) {
-							c.log("io.Copy (2 / remote -> local) failed: %v", err)
-						}
-					}(lConn, rConn)
-
-					wg.Wait()
-
-					err = lConn.Close()
-					if err != nil && err != io.EOF {
-						c.log("lConn.Close failed: %v", err)
-					}
-					err = rConn.Close()
-					if err != nil && err != io.EOF {
-						c.log("rConn.Close failed: %v", err)
-					}
-				}(lConn)
-			}
-		}
+// ForwardTunnel starts the tunnel's configured local forward, carrying
+// connections accepted on netAddress to sshAddress over the SSH session.
+// Equivalent to ForwardTunnelContext(context.Background()).
+func (c *SSHTunnel) ForwardTunnel() *Forward {
+	return c.ForwardTunnelContext(context.Background())
+}
 
-		c.log("Stopped Tunnel")
-	}()
+// ForwardTunnelContext is like ForwardTunnel, but the forward additionally
+// stops when ctx is done, alongside Close() and Forward.Close().
+func (c *SSHTunnel) ForwardTunnelContext(ctx context.Context) *Forward {
+	return c.addForward(ctx, ForwardKindForward, c.netAddress, c.sshAddress)
 }
 
-func (c *SSHTunnel) ReverseTunnel() {
-	c.log("Starting Tunnel")
-
-	c.wg.Add(1)
-	go func() {
-		defer c.wg.Done()
-
-		c.log("Started Tunnel")
-
-		_ = c.sshConnect()
-
-		for !c.closed {
-			err := c.sshListen()
-			if err != nil {
-				time.Sleep(c.attemptSleepTime)
-				continue
-			}
-
-			for !c.closed {
-				rConn, err := c.accept()
-				if err != nil {
-					c.closeListener()
-					time.Sleep(c.attemptSleepTime)
-					break
-				}
-
-				c.wg.Add(1)
-				go func(rConn net.Conn) {
-					defer c.wg.Done()
-
-					lConn, err := c.netDial()
-
-					if err != nil {
-						err = rConn.Close()
-						if err != nil && err != io.EOF {
-							c.log("rConn.Close failed: %v", err)
-						}
-						time.Sleep(c.attemptSleepTime)
-						return
-					}
-
-					// set deadline for local connection
-					err = lConn.SetDeadline(time.Now().Add(c.ioTimeout))
-					if err != nil {
-						c.log("SetDeadline failed: %v", err)
-					}
-
-					wg := &sync.WaitGroup{}
-					wg.Add(2)
-					go func(lConn net.Conn, rConn net.Conn) {
-						defer wg.Done()
-						// Push localPort to remotePort
-						_, err := io.Copy(lConn, rConn)
-						if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrDeadlineExceeded) {
-							c.log("io.Copy (1 / local -> remote) failed: %v", err)
-						}
-					}(lConn, rConn)
-
-					go func(lConn net.Conn, rConn net.Conn) {
-						defer wg.Done()
-						// Pull remotePort to localPort
-						_, err := io.Copy(rConn, lConn)
-						if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrDeadlineExceeded) {
-							c.log("io.Copy (2 / remote -> local) failed: %v", err)
-						}
-					}(lConn, rConn)
-
-					wg.Wait()
-
-					err = lConn.Close()
-					if err != nil && err != io.EOF {
-						c.log("lConn.Close failed: %v", err)
-					}
-					err = rConn.Close()
-					if err != nil && err != io.EOF {
-						c.log("rConn.Close failed: %v", err)
-					}
-				}(rConn)
-			}
-		}
+// ReverseTunnel starts the tunnel's configured reverse forward, carrying
+// connections accepted on sshAddress (as seen from the SSH server) to
+// netAddress. Equivalent to ReverseTunnelContext(context.Background()).
+func (c *SSHTunnel) ReverseTunnel() *Forward {
+	return c.ReverseTunnelContext(context.Background())
+}
+
+func (c *SSHTunnel) ReverseTunnelContext(ctx context.Context) *Forward {
+	return c.addForward(ctx, ForwardKindReverse, c.netAddress, c.sshAddress)
+}
+
+// DynamicTunnel starts a local SOCKS5 listener on netAddress. Each accepted
+// client negotiates the SOCKS handshake and the requested target is dialed
+// through the SSH session, giving "ssh -D" style dynamic port forwarding.
+// Equivalent to DynamicTunnelContext(context.Background()).
+func (c *SSHTunnel) DynamicTunnel() *Forward {
+	return c.DynamicTunnelContext(context.Background())
+}
 
-		c.log("Stopped Tunnel")
-	}()
+func (c *SSHTunnel) DynamicTunnelContext(ctx context.Context) *Forward {
+	return c.addForward(ctx, ForwardKindDynamic, c.netAddress, "")
 }
 
 func (c *SSHTunnel) Wait() {
@@ -0,0 +1,86 @@
+package sshtunnel
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSSHConnectContextSingleFlight exercises chunk0-4: many goroutines
+// racing to reconnect a dead shared session must result in exactly one
+// dial, with the rest reusing the connection the winner established.
+//
+// Each goroutine only calls sshConnectContext if it has a reason to, the
+// same way every real caller (sshDialToContext, Forward.sshListen, the
+// keepalive goroutine) does: it reads sshClient itself first, and skips the
+// call entirely once it sees someone else already connected. The client it
+// did observe (nil, for whichever of these goroutines get there first) is
+// passed through, so sshConnectContext can tell whether that's still the
+// current state by the time connectMx lets it proceed.
+func TestSSHConnectContextSingleFlight(t *testing.T) {
+	server := newTestSSHServer(t)
+	defer server.close()
+
+	c := newTestTunnel(server)
+	defer c.Close()
+
+	const callers = 8
+	var wg sync.WaitGroup
+	wg.Add(callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		go func(i int) {
+			defer wg.Done()
+			c.mx.Lock()
+			client := c.sshClient
+			c.mx.Unlock()
+			if client == nil {
+				errs[i] = c.sshConnectContext(c.ctx, client)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("sshConnectContext()[%d] = %v, want nil", i, err)
+		}
+	}
+
+	c.mx.Lock()
+	generation := c.generation
+	client := c.sshClient
+	c.mx.Unlock()
+
+	if client == nil {
+		t.Fatal("sshClient is nil after concurrent sshConnectContext calls")
+	}
+	if generation != 1 {
+		t.Errorf("generation = %d, want 1 (single-flighted dial)", generation)
+	}
+}
+
+// TestCloseCancelsInProgressBackoff exercises chunk0-4's context-driven
+// lifecycle: Close() must preempt an in-progress backoff sleep instead of
+// making callers wait out the configured delay.
+func TestCloseCancelsInProgressBackoff(t *testing.T) {
+	c := NewSSHTunnel(nil, "unused", "0", "0")
+	c.SetNoLogger()
+	c.SetAttemptSleepTime(time.Minute)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.sleepBackoff(c.ctx)
+	}()
+
+	// Give sleepBackoff a moment to enter the select before cancelling.
+	time.Sleep(20 * time.Millisecond)
+	c.Close()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("sleepBackoff did not return promptly after Close/cancel")
+	}
+}
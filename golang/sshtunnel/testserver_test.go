@@ -0,0 +1,336 @@
+package sshtunnel
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testDirectTCPIPPayload is the RFC 4254 ssh-connection "direct-tcpip"
+// channel open payload.
+type testDirectTCPIPPayload struct {
+	Host          string
+	Port          uint32
+	OriginAddress string
+	OriginPort    uint32
+}
+
+// testForwardedTCPIPPayload is the payload sent when opening a
+// "forwarded-tcpip" channel back to the client for a tcpip-forward listener.
+type testForwardedTCPIPPayload struct {
+	Address       string
+	Port          uint32
+	OriginAddress string
+	OriginPort    uint32
+}
+
+// testTCPIPForwardPayload is the "tcpip-forward"/"cancel-tcpip-forward"
+// global request payload.
+type testTCPIPForwardPayload struct {
+	Address string
+	Port    uint32
+}
+
+// testSSHServer is a minimal in-process SSH server used to exercise an
+// SSHTunnel against a real golang.org/x/crypto/ssh session: it accepts any
+// client (auth isn't what these tests cover), proxies direct-tcpip channels
+// to the requested target, and honors tcpip-forward/cancel-tcpip-forward so
+// ssh.Client.Listen (used by AddReverse) works end-to-end.
+type testSSHServer struct {
+	t        *testing.T
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	mx       sync.Mutex
+	conns    []*ssh.ServerConn
+	forwards map[string]net.Listener
+}
+
+func newTestSSHServer(t *testing.T) *testSSHServer {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromSigner(priv)
+	if err != nil {
+		t.Fatalf("ssh.NewSignerFromSigner: %v", err)
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	s := &testSSHServer{
+		t:        t,
+		listener: listener,
+		config:   config,
+		forwards: map[string]net.Listener{},
+	}
+	go s.serve()
+	return s
+}
+
+func (s *testSSHServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *testSSHServer) close() {
+	_ = s.listener.Close()
+	s.mx.Lock()
+	for _, listener := range s.forwards {
+		_ = listener.Close()
+	}
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mx.Unlock()
+}
+
+// dropConnections closes every SSH connection accepted so far, without
+// stopping the listener, so tests can simulate a dead link and exercise
+// keepalive/reconnect.
+func (s *testSSHServer) dropConnections() {
+	s.mx.Lock()
+	conns := append([]*ssh.ServerConn(nil), s.conns...)
+	s.conns = nil
+	s.mx.Unlock()
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+}
+
+func (s *testSSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *testSSHServer) handleConn(conn net.Conn) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	s.mx.Lock()
+	s.conns = append(s.conns, sshConn)
+	s.mx.Unlock()
+
+	go s.handleGlobalRequests(sshConn, reqs)
+
+	for newChannel := range chans {
+		go s.handleChannel(newChannel)
+	}
+}
+
+func (s *testSSHServer) handleChannel(newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() != "direct-tcpip" {
+		_ = newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+		return
+	}
+
+	var payload testDirectTCPIPPayload
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, "malformed direct-tcpip request")
+		return
+	}
+
+	target := net.JoinHostPort(payload.Host, fmt.Sprintf("%d", payload.Port))
+	targetConn, err := net.Dial("tcp", target)
+	if err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		_ = targetConn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	s.pipe(channel, targetConn)
+}
+
+func (s *testSSHServer) handleGlobalRequests(sshConn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		switch req.Type {
+		case "tcpip-forward":
+			s.handleTCPIPForward(sshConn, req)
+		case "cancel-tcpip-forward":
+			s.handleCancelTCPIPForward(req)
+		default:
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func (s *testSSHServer) handleTCPIPForward(sshConn *ssh.ServerConn, req *ssh.Request) {
+	var payload testTCPIPForwardPayload
+	if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+		if req.WantReply {
+			_ = req.Reply(false, nil)
+		}
+		return
+	}
+
+	bindAddr := net.JoinHostPort(payload.Address, fmt.Sprintf("%d", payload.Port))
+	listener, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		if req.WantReply {
+			_ = req.Reply(false, nil)
+		}
+		return
+	}
+
+	s.mx.Lock()
+	s.forwards[bindAddr] = listener
+	s.mx.Unlock()
+
+	if req.WantReply {
+		boundPort := listener.Addr().(*net.TCPAddr).Port
+		_ = req.Reply(true, ssh.Marshal(struct{ Port uint32 }{uint32(boundPort)}))
+	}
+
+	go s.acceptForwarded(sshConn, listener, payload.Address)
+}
+
+func (s *testSSHServer) acceptForwarded(sshConn *ssh.ServerConn, listener net.Listener, bindHost string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		originHost, originPortStr, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		var originPort uint64
+		fmt.Sscanf(originPortStr, "%d", &originPort)
+
+		payload := ssh.Marshal(testForwardedTCPIPPayload{
+			Address:       bindHost,
+			Port:          uint32(listener.Addr().(*net.TCPAddr).Port),
+			OriginAddress: originHost,
+			OriginPort:    uint32(originPort),
+		})
+
+		channel, requests, err := sshConn.OpenChannel("forwarded-tcpip", payload)
+		if err != nil {
+			_ = conn.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+
+		go s.pipe(channel, conn)
+	}
+}
+
+func (s *testSSHServer) handleCancelTCPIPForward(req *ssh.Request) {
+	var payload testTCPIPForwardPayload
+	if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+		if req.WantReply {
+			_ = req.Reply(false, nil)
+		}
+		return
+	}
+
+	bindAddr := net.JoinHostPort(payload.Address, fmt.Sprintf("%d", payload.Port))
+
+	s.mx.Lock()
+	listener, ok := s.forwards[bindAddr]
+	delete(s.forwards, bindAddr)
+	s.mx.Unlock()
+
+	if ok {
+		_ = listener.Close()
+	}
+	if req.WantReply {
+		_ = req.Reply(ok, nil)
+	}
+}
+
+// pipe bidirectionally copies between an SSH channel and a plain net.Conn,
+// closing both sides as soon as either direction returns.
+func (s *testSSHServer) pipe(channel ssh.Channel, conn net.Conn) {
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(conn, channel)
+		_ = channel.Close()
+		_ = conn.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(channel, conn)
+		_ = channel.Close()
+		_ = conn.Close()
+	}()
+	wg.Wait()
+}
+
+// newTestTunnel builds an SSHTunnel pointed at server, with logging
+// silenced.
+func newTestTunnel(server *testSSHServer) *SSHTunnel {
+	c := NewSSHTunnel(&ssh.ClientConfig{
+		User:            "test",
+		Auth:            []ssh.AuthMethod{},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         3 * time.Second,
+	}, server.addr(), "0", "0")
+	c.SetNoLogger()
+	return c
+}
+
+// newEchoListener starts a TCP listener that echoes back everything it
+// reads, for use as a forward target/client in tests.
+func newEchoListener(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 4096)
+				for {
+					n, err := conn.Read(buf)
+					if n > 0 {
+						if _, werr := conn.Write(buf[:n]); werr != nil {
+							return
+						}
+					}
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener
+}